@@ -0,0 +1,269 @@
+// Package avail tracks the health of the backend hosts a collection can be
+// routed to. It combines active probing (a background goroutine that
+// periodically dials each known host) with passive circuit breaking (the
+// router tells us when a proxied request actually failed), and hands back
+// a ranked, health-scored list of candidates rather than a flat set.
+package avail
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ewmaAlpha weights how quickly the rolling success average (probed
+	// or reported) and the rolling latency average (probed only - passive
+	// reports carry no timing) move in response to a new data point.
+	ewmaAlpha = 0.2
+
+	// failThreshold is the number of consecutive failures (probed or
+	// reported) before a host's breaker opens.
+	failThreshold = 3
+
+	minBreakerBackoff = 2 * time.Second
+	maxBreakerBackoff = 2 * time.Minute
+
+	probeTimeout = 1500 * time.Millisecond
+)
+
+// ScoredHost is a candidate backend ranked by its current rolling health
+// score - a blend of success rate and probe latency, see scoreFor (higher
+// is better; 1.0 is a host that has never failed and has zero latency).
+type ScoredHost struct {
+	Host  string
+	Score float64
+}
+
+// HostStatus is a point-in-time snapshot of one host's health, suitable for
+// the director's /status debug endpoint.
+type HostStatus struct {
+	Collection  string    `json:"collection"`
+	Host        string    `json:"host"`
+	Healthy     bool      `json:"healthy"`
+	Score       float64   `json:"score"`
+	LatencyMS   float64   `json:"latency_ms"`
+	LastProbe   time.Time `json:"last_probe"`
+	BreakerOpen bool      `json:"breaker_open"`
+}
+
+// Availability reports which hosts for a collection are currently able to
+// take traffic, ranked best-scored first.
+type Availability interface {
+	// AvailableHosts returns the subset of hosts (dialable at destPort)
+	// that are not breaker-tripped, ranked best-scored first. ctx is
+	// accepted for tracing/cancellation; lookups are in-memory and don't
+	// otherwise use it.
+	AvailableHosts(ctx context.Context, collectionName string, hosts []string, destPort string) ([]ScoredHost, error)
+
+	// ReportResult is the passive circuit breaker hook: the router calls
+	// this with the outcome of an actual proxied request so a host that
+	// is failing in practice cools off even before active probing
+	// notices.
+	ReportResult(collectionName, host, destPort string, failed bool)
+
+	// Status returns a snapshot of every host this Availability instance
+	// has probed or been told about.
+	Status() []HostStatus
+
+	// Run starts the background prober. It blocks probing known hosts
+	// every probeEvery until ctx is cancelled; callers should invoke it
+	// in its own goroutine.
+	Run(ctx context.Context)
+}
+
+type hostState struct {
+	mu               sync.Mutex
+	collection       string
+	host             string
+	successEWMA      float64
+	latencyEWMA      time.Duration
+	consecutiveFails int
+	breakerUntil     time.Time
+	lastProbe        time.Time
+}
+
+type availabilityImpl struct {
+	mu         sync.Mutex
+	hosts      map[string]*hostState // key: host:destPort
+	probeEvery time.Duration
+}
+
+// NewAvailability returns an Availability that actively probes every host
+// it is asked about (at probeEvery) and also accepts passive failure
+// reports from the router.
+func NewAvailability(probeEvery time.Duration) Availability {
+	if probeEvery <= 0 {
+		probeEvery = 5 * time.Second
+	}
+	return &availabilityImpl{hosts: make(map[string]*hostState), probeEvery: probeEvery}
+}
+
+func hostKey(host, destPort string) string {
+	return host + ":" + destPort
+}
+
+func (a *availabilityImpl) stateFor(collectionName, host, destPort string) *hostState {
+	k := hostKey(host, destPort)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, ok := a.hosts[k]
+	if !ok {
+		st = &hostState{collection: collectionName, host: host, successEWMA: 1}
+		a.hosts[k] = st
+	}
+	return st
+}
+
+func (a *availabilityImpl) AvailableHosts(ctx context.Context, collectionName string, hosts []string, destPort string) ([]ScoredHost, error) {
+	now := time.Now()
+	scored := make([]ScoredHost, 0, len(hosts))
+	for _, host := range hosts {
+		st := a.stateFor(collectionName, host, destPort)
+		st.mu.Lock()
+		open := now.Before(st.breakerUntil)
+		score := scoreFor(st.successEWMA, st.latencyEWMA)
+		st.mu.Unlock()
+		if open {
+			continue
+		}
+		scored = append(scored, ScoredHost{Host: host, Score: score})
+	}
+	sort.Slice(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	return scored, nil
+}
+
+// scoreFor blends a host's rolling success rate with its rolling probe
+// latency into the single rank AvailableHosts sorts by: success rate
+// dominates (it spans [0,1]), with latency as a tiebreaker among
+// similarly-healthy hosts - a slow host loses to an equally reliable fast
+// one.
+func scoreFor(successEWMA float64, latencyEWMA time.Duration) float64 {
+	return successEWMA / (1 + latencyEWMA.Seconds())
+}
+
+func (a *availabilityImpl) ReportResult(collectionName, host, destPort string, failed bool) {
+	st := a.stateFor(collectionName, host, destPort)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	recordResult(st, !failed)
+}
+
+// recordResult folds one probe or reported outcome into a host's rolling
+// state, opening the breaker with exponential backoff once the host has
+// failed failThreshold times in a row.
+func recordResult(st *hostState, success bool) {
+	v := 0.0
+	if success {
+		v = 1.0
+		st.consecutiveFails = 0
+	} else {
+		st.consecutiveFails++
+	}
+	st.successEWMA = ewmaAlpha*v + (1-ewmaAlpha)*st.successEWMA
+
+	if st.consecutiveFails >= failThreshold {
+		backoff := minBreakerBackoff << uint(st.consecutiveFails-failThreshold)
+		if backoff <= 0 || backoff > maxBreakerBackoff {
+			backoff = maxBreakerBackoff
+		}
+		st.breakerUntil = time.Now().Add(backoff)
+	}
+}
+
+// recordLatency folds an active probe's round-trip time into the host's
+// rolling latency EWMA. Passive reports from the router (ReportResult)
+// carry no timing information, so only probeOne calls this.
+func recordLatency(st *hostState, latency time.Duration) {
+	st.latencyEWMA = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(st.latencyEWMA))
+}
+
+func (a *availabilityImpl) Status() []HostStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	out := make([]HostStatus, 0, len(a.hosts))
+	for _, st := range a.hosts {
+		st.mu.Lock()
+		out = append(out, HostStatus{
+			Collection:  st.collection,
+			Host:        st.host,
+			Healthy:     st.consecutiveFails < failThreshold,
+			Score:       scoreFor(st.successEWMA, st.latencyEWMA),
+			LatencyMS:   float64(st.latencyEWMA) / float64(time.Millisecond),
+			LastProbe:   st.lastProbe,
+			BreakerOpen: now.Before(st.breakerUntil),
+		})
+		st.mu.Unlock()
+	}
+	return out
+}
+
+func (a *availabilityImpl) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.probeEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.probeAll()
+		}
+	}
+}
+
+// probeAll re-probes every host this Availability has seen so far - i.e.
+// every host some prior AvailableHosts or ReportResult call registered via
+// stateFor. It does not independently enumerate a collection's full host
+// set (HostsForCollection has no "list every collection" method to seed
+// from), so a backend that has never yet been routed to is not proactively
+// probed; its first real request still pays the full cost of discovering
+// it's down. Seeding from HostsForCollection at startup/reload would close
+// this gap if that interface grows an enumeration method.
+func (a *availabilityImpl) probeAll() {
+	a.mu.Lock()
+	targets := make([]string, 0, len(a.hosts))
+	for k := range a.hosts {
+		targets = append(targets, k)
+	}
+	a.mu.Unlock()
+
+	for _, k := range targets {
+		go a.probeOne(k)
+	}
+}
+
+// probeOne issues a lightweight TCP connect check against hostPort and
+// folds the result, and how long the dial took, into its rolling state.
+func (a *availabilityImpl) probeOne(hostPort string) {
+	a.mu.Lock()
+	st := a.hosts[hostPort]
+	a.mu.Unlock()
+	if st == nil {
+		return
+	}
+
+	now := time.Now()
+	dialStart := time.Now()
+	ok := dialOK(hostPort)
+	latency := time.Since(dialStart)
+
+	st.mu.Lock()
+	st.lastProbe = now
+	recordResult(st, ok)
+	if ok {
+		recordLatency(st, latency)
+	}
+	st.mu.Unlock()
+}
+
+func dialOK(hostPort string) bool {
+	conn, err := net.DialTimeout("tcp", hostPort, probeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,88 @@
+package avail
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAvailableHostsExcludesOpenBreaker(t *testing.T) {
+	a := NewAvailability(time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < failThreshold; i++ {
+		a.ReportResult("col", "host-a", "8000", true)
+	}
+
+	scored, err := a.AvailableHosts(ctx, "col", []string{"host-a", "host-b"}, "8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scored) != 1 || scored[0].Host != "host-b" {
+		t.Fatalf("got %v, want only host-b (host-a's breaker should be open)", scored)
+	}
+}
+
+func TestAvailableHostsRankedByScoreDescending(t *testing.T) {
+	a := NewAvailability(time.Hour)
+	ctx := context.Background()
+
+	a.ReportResult("col", "host-a", "8000", true)  // one failure: score drops below 1
+	a.ReportResult("col", "host-b", "8000", false) // success: score stays at 1
+
+	scored, err := a.AvailableHosts(ctx, "col", []string{"host-a", "host-b", "host-c"}, "8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scored) != 3 {
+		t.Fatalf("got %d hosts, want 3", len(scored))
+	}
+	if scored[len(scored)-1].Host != "host-a" {
+		t.Fatalf("got %v, want host-a (lowest score) ranked last", scored)
+	}
+	for i := 1; i < len(scored); i++ {
+		if scored[i].Score > scored[i-1].Score {
+			t.Fatalf("got %v, want descending score order", scored)
+		}
+	}
+}
+
+func TestScoreForPrefersLowerLatencyAtEqualSuccessRate(t *testing.T) {
+	fast := scoreFor(1, 10*time.Millisecond)
+	slow := scoreFor(1, 2*time.Second)
+	if fast <= slow {
+		t.Fatalf("got fast=%v, slow=%v, want fast > slow at the same success rate", fast, slow)
+	}
+}
+
+func TestRecordLatencyTracksARollingAverage(t *testing.T) {
+	st := &hostState{}
+
+	for i := 0; i < 50; i++ {
+		recordLatency(st, 100*time.Millisecond)
+	}
+	if got := st.latencyEWMA; got < 90*time.Millisecond || got > 110*time.Millisecond {
+		t.Fatalf("latencyEWMA = %v, want it to converge to ~100ms", got)
+	}
+}
+
+func TestRecordResultOpensBreakerAfterConsecutiveFailures(t *testing.T) {
+	st := &hostState{successEWMA: 1}
+
+	for i := 0; i < failThreshold-1; i++ {
+		recordResult(st, false)
+	}
+	if !st.breakerUntil.IsZero() {
+		t.Fatalf("breaker should still be closed before failThreshold consecutive failures")
+	}
+
+	recordResult(st, false)
+	if !st.breakerUntil.After(time.Now()) {
+		t.Fatalf("breaker should be open (backed off into the future) after %d consecutive failures", failThreshold)
+	}
+
+	recordResult(st, true)
+	if st.consecutiveFails != 0 {
+		t.Fatalf("a success should reset consecutiveFails to 0, got %d", st.consecutiveFails)
+	}
+}
@@ -0,0 +1,43 @@
+// Package hosts resolves which physical hosts back a given collection.
+package hosts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// HostsForCollection resolves a collection name to the set of hosts that
+// store it.
+type HostsForCollection interface {
+	GetHostNames(ctx context.Context, collectionName string) ([]string, error)
+}
+
+type staticHostsForCollection struct {
+	mu    sync.RWMutex
+	hosts map[string][]string
+}
+
+// NewHostsForCollection returns a HostsForCollection backed by a static,
+// in-memory mapping, populated via Set. Production deployments populate
+// this from nimbus.io's central database.
+func NewHostsForCollection() HostsForCollection {
+	return &staticHostsForCollection{hosts: make(map[string][]string)}
+}
+
+// Set registers the hosts that back collectionName.
+func (s *staticHostsForCollection) Set(collectionName string, hostNames []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts[collectionName] = hostNames
+}
+
+func (s *staticHostsForCollection) GetHostNames(ctx context.Context, collectionName string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hostNames, ok := s.hosts[collectionName]
+	if !ok {
+		return nil, fmt.Errorf("no hosts known for collection '%s'", collectionName)
+	}
+	return hostNames, nil
+}
@@ -0,0 +1,119 @@
+// Command webdirector is nimbus.io's director: it decides which backend
+// <host>:<port> each incoming request should be routed to and reverse
+// proxies accordingly.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"webdirector/avail"
+	"webdirector/hosts"
+	"webdirector/mgmtapi"
+	"webdirector/router"
+)
+
+func main() {
+	configPath := os.Getenv("NIMBUSIO_WEB_DIRECTOR_CONFIG")
+	if configPath == "" {
+		configPath = "/etc/nimbus.io/webdirector.json"
+	}
+	config, err := router.NewConfigStore(configPath)
+	if err != nil {
+		log.Fatalf("loading config '%s': %s", configPath, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	availability := avail.NewAvailability(config.Current().HealthCheckInterval)
+	go availability.Run(ctx)
+
+	if os.Getenv("NIMBUSIO_WEB_DIRECTOR_CONFIG_AUTORELOAD") != "" {
+		go config.WatchFile(ctx, 5*time.Second)
+	}
+
+	// NewLeastConnections as the default strategy, rather than something
+	// stateless like RoundRobin, means every collection - not just ones
+	// with an explicit override - gets its in-flight count tracked via
+	// Acquire/Release.
+	strategyPolicy := router.NewConfigStrategyPolicy(config, availability, router.NewLeastConnections())
+
+	rtr := router.NewRouter(mgmtapi.NewManagementAPIDestinations(),
+		hosts.NewHostsForCollection(), availability, config, nil, strategyPolicy,
+		router.NewConfigLimiter(config))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", statusHandler(availability))
+	mux.HandleFunc("/", routeHandler(rtr))
+
+	server := &http.Server{Addr: os.Getenv("NIMBUSIO_WEB_DIRECTOR_PORT"), Handler: mux}
+
+	// SIGHUP reloads routing policy from disk without dropping
+	// connections: requests already in flight keep running under the
+	// Config they read, new ones pick up whatever Reload just swapped in.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			if err := config.Reload(configPath); err != nil {
+				log.Printf("config: reload of '%s' failed: %s", configPath, err)
+				continue
+			}
+			log.Printf("config: reloaded '%s'", configPath)
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigCh
+		cancel()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("webdirector listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// routeHandler reverse proxies to whatever host the Router picks, or
+// reports the RouterError's HTTP code back to the client.
+func routeHandler(rtr router.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		dest, report, err := rtr.Route(req)
+		if err != nil {
+			if routerErr, ok := err.(router.RouterError); ok {
+				for name, values := range routerErr.Headers() {
+					for _, value := range values {
+						w.Header().Add(name, value)
+					}
+				}
+				w.Header().Set("X-Request-ID", routerErr.CorrelationID())
+				http.Error(w, routerErr.ErrorMessage(), routerErr.HTTPCode())
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		newProxyHandler(dest, report).ServeHTTP(w, req)
+	}
+}
+
+// statusHandler exposes every host's probed/reported health for operators,
+// e.g. `curl http://director:port/status`.
+func statusHandler(availability avail.Availability) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(availability.Status())
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// newProxyHandler returns a reverse proxy to the given <host>:<port>. If
+// report is non-nil, it is called once the proxied request completes,
+// with whether it failed (a connection error, or a 5xx response) - this
+// is what feeds the avail package's passive circuit breaker.
+func newProxyHandler(destHostPort string, report func(failed bool)) *httputil.ReverseProxy {
+	target := &url.URL{Scheme: "http", Host: destHostPort}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	if report == nil {
+		return proxy
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		report(resp.StatusCode >= http.StatusInternalServerError)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		report(true)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
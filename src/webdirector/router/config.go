@@ -0,0 +1,262 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webdirector/avail"
+)
+
+// PoolConfig is one named backend pool's read/write destination ports,
+// e.g. "archive" vs "hot", or "ssd" vs "hdd".
+type PoolConfig struct {
+	ReadPort  string `json:"read_port"`
+	WritePort string `json:"write_port"`
+}
+
+// RateLimitConfig is a token-bucket rate limit: requests refill at
+// RatePerSecond, up to a maximum burst of Burst. A zero/absent
+// RatePerSecond means unlimited.
+type RateLimitConfig struct {
+	RatePerSecond float64 `json:"rate_per_second"`
+	Burst         float64 `json:"burst"`
+}
+
+// burstOrDefault treats a zero Burst as "no burst allowance beyond the
+// steady-state rate."
+func (r RateLimitConfig) burstOrDefault() float64 {
+	if r.Burst <= 0 {
+		// At least one whole request, so a rate below 1/s still lets
+		// requests through at that rate.
+		return math.Max(r.RatePerSecond, 1)
+	}
+	return r.Burst
+}
+
+// CollectionConfig is a per-collection override of routing policy, e.g.
+// "this collection reads via consistent hashing but writes round robin."
+// Strategy names are resolved by ResolveStrategy.
+type CollectionConfig struct {
+	ReadStrategy  string `json:"read_strategy,omitempty"`
+	WriteStrategy string `json:"write_strategy,omitempty"`
+}
+
+// Config is the routing policy an operator may want to change without
+// restarting the director: the service domain, the destination port
+// pools, per-collection overrides, resolvers, the default backend and rate
+// limits. HealthCheckInterval is read once, at startup, so a Reload does
+// not change how often backends are probed. ManagementAPIDests is parsed
+// but not read by the router, which takes its management API destinations
+// from the mgmtapi package; changing it has no effect.
+type Config struct {
+	ServiceDomain       string                      `json:"service_domain"`
+	Pools               map[string]PoolConfig       `json:"pools"`
+	ManagementAPIDests  []string                    `json:"management_api_destinations,omitempty"`
+	CollectionOverrides map[string]CollectionConfig `json:"collection_overrides,omitempty"`
+	HealthCheckInterval time.Duration               `json:"health_check_interval"`
+
+	// TrustForwardedFor controls whether Route takes the client IP it
+	// logs from X-Forwarded-For. Only enable this when the director sits
+	// behind a proxy that sets (and strips any client-supplied) that
+	// header; otherwise a client can put whatever it wants in the logs.
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+
+	// Resolvers is the ordered list of collection resolution mechanisms
+	// to try ("hostname", "path_prefix", "header"). Unset means all
+	// three, in that order; a deployment that wants to disable e.g.
+	// path-prefix routing lists only the ones it wants.
+	Resolvers []string `json:"resolvers,omitempty"`
+
+	// DefaultBackend is the <host>:<port> (or "" to instead return 400)
+	// to route to when every resolver fails to find a collection, e.g. a
+	// static website or the management API.
+	DefaultBackend string `json:"default_backend,omitempty"`
+
+	// RateLimits holds per-collection, per-method-class ("read"/"write")
+	// token-bucket limits, keyed by collection name. DefaultRateLimits
+	// applies to collections with no entry here. Either may be sourced
+	// from the management API and folded in before a Reload.
+	RateLimits        map[string]map[string]RateLimitConfig `json:"rate_limits,omitempty"`
+	DefaultRateLimits map[string]RateLimitConfig            `json:"default_rate_limits,omitempty"`
+}
+
+// ConfigStore holds the live Config behind an atomic.Value so Reload can
+// swap it out while requests are in flight: a request that already read
+// the old *Config finishes under it, and the very next Route call picks
+// up the new one.
+type ConfigStore struct {
+	value atomic.Value // *Config
+	path  string
+}
+
+// NewConfigStore loads path and returns a ConfigStore wrapping it.
+func NewConfigStore(path string) (*ConfigStore, error) {
+	store := &ConfigStore{path: path}
+	if err := store.Reload(path); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload re-reads path (JSON) and atomically swaps it in as the live
+// Config. It can be called at any time, including concurrently with
+// in-flight requests.
+func (s *ConfigStore) Reload(path string) error {
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	s.path = path
+	s.value.Store(cfg)
+	return nil
+}
+
+// Current returns the live Config. Callers should fetch it once per
+// request rather than holding onto it, so a Reload takes effect
+// immediately for new requests.
+func (s *ConfigStore) Current() *Config {
+	cfg, _ := s.value.Load().(*Config)
+	return cfg
+}
+
+func loadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config '%s': %s", path, err)
+	}
+	cfg := &Config{Pools: make(map[string]PoolConfig)}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config '%s': %s", path, err)
+	}
+	if _, ok := cfg.Pools[defaultPool]; !ok {
+		return nil, fmt.Errorf("config '%s' has no '%s' pool", path, defaultPool)
+	}
+	return cfg, nil
+}
+
+// WatchFile is opt-in auto-reload: it polls path's mtime every pollEvery
+// and calls Reload whenever it changes, until ctx is cancelled. Most
+// deployments are expected to reload via SIGHUP instead; this is for
+// environments (e.g. a mounted ConfigMap) where nothing sends a signal.
+func (s *ConfigStore) WatchFile(ctx context.Context, pollEvery time.Duration) {
+	var lastMod time.Time
+	if info, err := os.Stat(s.path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(pollEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil || !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			if err := s.Reload(s.path); err != nil {
+				log.Printf("config: auto-reload of '%s' failed: %s", s.path, err)
+			}
+		}
+	}
+}
+
+// configPortPolicy reads pool/port info from the live Config on every
+// call, so a Reload takes effect for the very next request without
+// restarting the router.
+type configPortPolicy struct {
+	store *ConfigStore
+}
+
+// NewConfigPortPolicy returns a PortPolicy backed by store's live Config.
+func NewConfigPortPolicy(store *ConfigStore) PortPolicy {
+	return &configPortPolicy{store: store}
+}
+
+func (p *configPortPolicy) DestPort(collectionName string, req *http.Request) (string, error) {
+	cfg := p.store.Current()
+
+	pool := req.Header.Get(poolHeader)
+	if pool == "" {
+		pool = defaultPool
+	}
+
+	poolCfg, ok := cfg.Pools[pool]
+	if !ok {
+		return "", fmt.Errorf("unknown backend pool '%s'", pool)
+	}
+	if isWriteMethod(req.Method) {
+		return poolCfg.WritePort, nil
+	}
+	return poolCfg.ReadPort, nil
+}
+
+// configStrategyPolicy reads per-collection strategy overrides from the
+// live Config on every call, so operators can change a collection's
+// routing strategy via Reload/SIGHUP.
+type configStrategyPolicy struct {
+	store        *ConfigStore
+	availability avail.Availability
+	def          RoutingStrategy
+
+	mu    sync.Mutex
+	cache map[string]RoutingStrategy // "<collection>:<strategy name>" -> resolved instance
+}
+
+// NewConfigStrategyPolicy returns a StrategyPolicy backed by store's live
+// Config, falling back to def for collections with no override.
+func NewConfigStrategyPolicy(store *ConfigStore, availability avail.Availability, def RoutingStrategy) StrategyPolicy {
+	return &configStrategyPolicy{
+		store: store, availability: availability, def: def,
+		cache: make(map[string]RoutingStrategy),
+	}
+}
+
+func (p *configStrategyPolicy) StrategyFor(collectionName string, req *http.Request) RoutingStrategy {
+	cfg := p.store.Current()
+	override, ok := cfg.CollectionOverrides[collectionName]
+	if !ok {
+		return p.def
+	}
+
+	name := override.ReadStrategy
+	if isWriteMethod(req.Method) && override.WriteStrategy != "" {
+		name = override.WriteStrategy
+	}
+	if name == "" {
+		return p.def
+	}
+	return p.strategyFor(collectionName, name)
+}
+
+// strategyFor returns the cached RoutingStrategy for (collectionName,
+// name), resolving it via ResolveStrategy and caching it on first use.
+// Stateful strategies like RoundRobin and LeastConnections must be reused
+// across requests - a fresh instance every call would silently reset
+// their state (round-robin's cursor, least-connections' counts) back to
+// zero each time.
+func (p *configStrategyPolicy) strategyFor(collectionName, name string) RoutingStrategy {
+	key := collectionName + ":" + name
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if strategy, ok := p.cache[key]; ok {
+		return strategy
+	}
+	strategy, err := ResolveStrategy(name, p.availability)
+	if err != nil {
+		return p.def
+	}
+	p.cache[key] = strategy
+	return strategy
+}
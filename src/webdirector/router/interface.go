@@ -0,0 +1,32 @@
+package router
+
+import "net/http"
+
+// Router decides which backend <host>:<port> a request should be routed
+// to.
+type Router interface {
+	// Route returns the chosen destination and, whenever that destination
+	// names an actual backend, a report func the caller must invoke
+	// exactly once - after it has actually proxied the request - with
+	// whether that request failed. This is the passive circuit breaker
+	// hook: Route can't know the outcome itself, since it returns before
+	// the request is ever sent.
+	Route(req *http.Request) (dest string, report func(failed bool), err error)
+}
+
+// RouterError is returned by Route when a request cannot be routed. It
+// carries enough information for the HTTP boundary to respond with the
+// right status code and message.
+type RouterError interface {
+	error
+	HTTPCode() int
+	ErrorMessage() string
+
+	// CorrelationID is the request's correlation ID, for the HTTP
+	// boundary to log or echo back to the caller.
+	CorrelationID() string
+
+	// Headers are extra response headers the HTTP boundary should set
+	// before writing the error, e.g. Retry-After on a 429.
+	Headers() http.Header
+}
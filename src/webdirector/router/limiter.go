@@ -0,0 +1,166 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter enforces per-collection rate limits. Route invokes it right
+// after collection resolution and before any host lookup, so a throttled
+// request never reaches hosts.GetHostNames or avail.AvailableHosts.
+type Limiter interface {
+	// Allow reports whether a request for collectionName in methodClass
+	// ("read" or "write", see methodClass) may proceed. If not, retryAfter
+	// is how long the caller should wait for the bucket to refill.
+	Allow(ctx context.Context, collectionName, methodClass string) (allowed bool, retryAfter time.Duration)
+}
+
+// methodClass buckets an HTTP method into "read" or "write" so writes can
+// be limited more aggressively than reads.
+func methodClass(method string) string {
+	if isWriteMethod(method) {
+		return "write"
+	}
+	return "read"
+}
+
+// tokenBucket is a standard token bucket: it refills at ratePerSec up to
+// burst, and take() succeeds iff at least one token is available.
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	ratePerSec float64
+	burst      float64
+	last       time.Time
+}
+
+func newTokenBucket(ratePerSec, burst float64) *tokenBucket {
+	return &tokenBucket{tokens: burst, ratePerSec: ratePerSec, burst: burst, last: time.Now()}
+}
+
+// take refills the bucket under the rate/burst its previous call applied
+// (the ones it was created with, before any call), then applies ratePerSec/burst before deciding - so a config Reload that
+// changes a limit takes effect on the very next call for a bucket that's
+// been live since before the Reload, rather than being stuck at whatever
+// limit was live when this bucket was first created.
+func (b *tokenBucket) take(ratePerSec, burst float64) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.ratePerSec)
+	b.last = now
+
+	b.ratePerSec = ratePerSec
+	b.burst = burst
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	retryAfter := time.Duration((1 - b.tokens) / b.ratePerSec * float64(time.Second))
+	return false, retryAfter
+}
+
+// configLimiter is the in-memory Limiter for single-node deployments: it
+// keeps one token bucket per (collection, method class) and reads the
+// rate/burst for that bucket from the live Config, so operators can
+// reload limits via the config file / SIGHUP.
+type configLimiter struct {
+	store   *ConfigStore
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewConfigLimiter returns an in-memory Limiter backed by store's live
+// Config.
+func NewConfigLimiter(store *ConfigStore) Limiter {
+	return &configLimiter{store: store, buckets: make(map[string]*tokenBucket)}
+}
+
+func (l *configLimiter) Allow(ctx context.Context, collectionName, methodClass string) (bool, time.Duration) {
+	limit, ok := lookupRateLimit(l.store.Current(), collectionName, methodClass)
+	if !ok || limit.RatePerSecond <= 0 {
+		return true, 0
+	}
+
+	key := collectionName + ":" + methodClass
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(limit.RatePerSecond, limit.burstOrDefault())
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.take(limit.RatePerSecond, limit.burstOrDefault())
+}
+
+func lookupRateLimit(cfg *Config, collectionName, methodClass string) (RateLimitConfig, bool) {
+	if perCollection, ok := cfg.RateLimits[collectionName]; ok {
+		if limit, ok := perCollection[methodClass]; ok {
+			return limit, true
+		}
+	}
+	limit, ok := cfg.DefaultRateLimits[methodClass]
+	return limit, ok
+}
+
+// RedisClient is the minimal surface RedisLimiter needs to share quota
+// state across a cluster of directors, satisfied by a thin wrapper around
+// *redis.Client (github.com/go-redis/redis).
+type RedisClient interface {
+	Incr(ctx context.Context, key string) (int64, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	PTTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// RedisLimiter is a fixed-window rate limiter shared across a cluster via
+// Redis, so every director instance enforces the same quota for a
+// collection rather than each getting its own. It fails open on Redis
+// errors: a quota-tracking outage shouldn't take down routing.
+type RedisLimiter struct {
+	client RedisClient
+	store  *ConfigStore
+	window time.Duration
+}
+
+// NewRedisLimiter returns a Limiter that tracks one counter per
+// (collection, method class) per window in Redis.
+func NewRedisLimiter(client RedisClient, store *ConfigStore, window time.Duration) *RedisLimiter {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &RedisLimiter{client: client, store: store, window: window}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, collectionName, methodClass string) (bool, time.Duration) {
+	limit, ok := lookupRateLimit(l.store.Current(), collectionName, methodClass)
+	if !ok || limit.RatePerSecond <= 0 {
+		return true, 0
+	}
+
+	key := fmt.Sprintf("nimbus:webdirector:ratelimit:%s:%s", collectionName, methodClass)
+	count, err := l.client.Incr(ctx, key)
+	if err != nil {
+		return true, 0
+	}
+	if count == 1 {
+		l.client.Expire(ctx, key, l.window)
+	}
+	if float64(count) <= limit.burstOrDefault() {
+		return true, 0
+	}
+
+	ttl, err := l.client.PTTL(ctx, key)
+	if err != nil || ttl < 0 {
+		ttl = l.window
+	}
+	return false, ttl
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllowsBurstThenThrottles(t *testing.T) {
+	b := newTokenBucket(1, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.take(1, 3); !ok {
+			t.Fatalf("take %d: expected allowed within burst", i)
+		}
+	}
+	ok, retryAfter := b.take(1, 3)
+	if ok {
+		t.Fatalf("expected throttled once burst is exhausted")
+	}
+	if retryAfter <= 0 {
+		t.Fatalf("expected a positive retryAfter, got %v", retryAfter)
+	}
+}
+
+func TestTokenBucketPicksUpATightenedLimit(t *testing.T) {
+	b := newTokenBucket(1000, 1)
+	if ok, _ := b.take(1000, 1); !ok {
+		t.Fatalf("expected the first request within burst to be allowed")
+	}
+
+	// Reload tightens the rate drastically. The very next take(), even
+	// though this bucket has been live since before the reload, should
+	// see a retryAfter computed from the new, much slower rate - not one
+	// based on the stale 1000/sec it was created with.
+	_, retryAfter := b.take(0.001, 1)
+	if retryAfter < time.Second {
+		t.Fatalf("got retryAfter %v, want it to reflect the tightened rate (>= 1s)", retryAfter)
+	}
+}
+
+func TestMethodClass(t *testing.T) {
+	cases := []struct{ method, want string }{
+		{"GET", "read"}, {"HEAD", "read"},
+		{"POST", "write"}, {"PUT", "write"}, {"PATCH", "write"}, {"DELETE", "write"},
+	}
+	for _, c := range cases {
+		if got := methodClass(c.method); got != c.want {
+			t.Errorf("methodClass(%s) = %q, want %q", c.method, got, c.want)
+		}
+	}
+}
+
+func newTestConfigStore(t *testing.T, body string) *ConfigStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewConfigStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestConfigLimiterUnlimitedByDefault(t *testing.T) {
+	store := newTestConfigStore(t, `{"pools":{"default":{"read_port":"80","write_port":"81"}}}`)
+	limiter := NewConfigLimiter(store)
+
+	for i := 0; i < 5; i++ {
+		if allowed, _ := limiter.Allow(context.Background(), "mycollection", "read"); !allowed {
+			t.Fatalf("request %d: expected no limit configured to mean unlimited", i)
+		}
+	}
+}
+
+func TestConfigLimiterEnforcesDefaultRateLimit(t *testing.T) {
+	store := newTestConfigStore(t, `{
+		"pools": {"default": {"read_port": "80", "write_port": "81"}},
+		"default_rate_limits": {"read": {"rate_per_second": 1, "burst": 2}}
+	}`)
+	limiter := NewConfigLimiter(store)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow(ctx, "mycollection", "read"); !allowed {
+			t.Fatalf("request %d: expected allowed within burst", i)
+		}
+	}
+	if allowed, retryAfter := limiter.Allow(ctx, "mycollection", "read"); allowed || retryAfter <= 0 {
+		t.Fatalf("got (allowed=%v, retryAfter=%v), want throttled with a positive retryAfter", allowed, retryAfter)
+	}
+}
+
+func TestConfigLimiterPicksUpReloadedLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(body string) {
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{
+		"pools": {"default": {"read_port": "80", "write_port": "81"}},
+		"default_rate_limits": {"read": {"rate_per_second": 1000, "burst": 1}}
+	}`)
+	store, err := NewConfigStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewConfigLimiter(store)
+	ctx := context.Background()
+
+	if allowed, _ := limiter.Allow(ctx, "mycollection", "read"); !allowed {
+		t.Fatalf("expected the first request within burst to be allowed")
+	}
+
+	// SIGHUP/Reload tightens the limit drastically. The bucket for
+	// "mycollection":"read" already exists from the call above; it must
+	// not keep enforcing the fast rate it was created under.
+	write(`{
+		"pools": {"default": {"read_port": "80", "write_port": "81"}},
+		"default_rate_limits": {"read": {"rate_per_second": 0.001, "burst": 1}}
+	}`)
+	if err := store.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if allowed, retryAfter := limiter.Allow(ctx, "mycollection", "read"); allowed || retryAfter < time.Second {
+		t.Fatalf("got (allowed=%v, retryAfter=%v), want throttled with a retryAfter reflecting the reloaded, tighter rate", allowed, retryAfter)
+	}
+}
+
+func TestConfigLimiterPerCollectionOverridesDefault(t *testing.T) {
+	store := newTestConfigStore(t, `{
+		"pools": {"default": {"read_port": "80", "write_port": "81"}},
+		"default_rate_limits": {"read": {"rate_per_second": 1, "burst": 1}},
+		"rate_limits": {"roomy": {"read": {"rate_per_second": 100, "burst": 100}}}
+	}`)
+	limiter := NewConfigLimiter(store)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if allowed, _ := limiter.Allow(ctx, "roomy", "read"); !allowed {
+			t.Fatalf("request %d: collection-specific override should not be this tight", i)
+		}
+	}
+}
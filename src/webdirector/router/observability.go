@@ -0,0 +1,76 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// tracer emits spans around Route and its subordinate calls (hosts
+// lookup, availability lookup, host selection) so operators can see which
+// stage dominates latency in a trace backend.
+var tracer = otel.Tracer("webdirector/router")
+
+// correlationIDFromRequest returns the caller-supplied correlation ID
+// (X-Request-ID, as propagated by upstream proxies) if present, or mints
+// a new one.
+func correlationIDFromRequest(req *http.Request) string {
+	if id := req.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return newCorrelationID()
+}
+
+func newCorrelationID() string {
+	var b [16]byte
+	// crypto/rand.Read never returns an error on the platforms we ship
+	// on; a zero-value ID is an acceptable, non-fatal degradation if it
+	// somehow does.
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// clientIP returns the client's address, honoring X-Forwarded-For only
+// when the Config says to trust it (i.e. the director sits behind a
+// proxy that sets it, rather than facing untrusted clients directly).
+func clientIP(cfg *Config, req *http.Request) string {
+	if cfg != nil && cfg.TrustForwardedFor {
+		if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// accessLogEntry is the single structured JSON line Route emits per
+// request.
+type accessLogEntry struct {
+	CorrelationID string  `json:"correlation_id"`
+	Collection    string  `json:"collection,omitempty"`
+	Host          string  `json:"host,omitempty"`
+	Strategy      string  `json:"strategy,omitempty"`
+	LatencyMS     float64 `json:"latency_ms"`
+	Method        string  `json:"method"`
+	ClientIP      string  `json:"client_ip"`
+	Error         string  `json:"error,omitempty"`
+	HTTPCode      int     `json:"http_code,omitempty"`
+}
+
+func logAccess(entry accessLogEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("router: failed to marshal access log entry: %s", err)
+		return
+	}
+	log.Println(string(data))
+}
@@ -0,0 +1,39 @@
+package router
+
+import "net/http"
+
+// writeMethods classifies methods that mutate a collection, as opposed to
+// reads (GET/HEAD). Strategy and port policies both use this split to let
+// deployments route reads and writes differently.
+var writeMethods = map[string]bool{
+	"POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+}
+
+func isWriteMethod(method string) bool {
+	return writeMethods[method]
+}
+
+// poolHeader lets a client (or an upstream proxy acting on its behalf)
+// select an alternate backend pool, e.g. archive vs hot storage, or SSD
+// vs HDD, without the director needing to know collection metadata.
+const poolHeader = "X-Nimbus-Pool"
+
+const defaultPool = "default"
+
+// PortPolicy decides which destination port a request should be sent to.
+// It replaces the old init-time, env-var-baked destPortMap with something
+// that can hold multiple backend pools and be swapped out at runtime. The
+// authoritative implementation is configPortPolicy (config.go), backed by
+// the live Config.
+type PortPolicy interface {
+	DestPort(collectionName string, req *http.Request) (string, error)
+}
+
+// StrategyPolicy decides which RoutingStrategy applies to a given
+// collection and request, so e.g. large collections can use
+// ConsistentHash for reads but RoundRobin for writes. The authoritative
+// implementation is configStrategyPolicy (config.go), backed by the live
+// Config's CollectionOverrides.
+type StrategyPolicy interface {
+	StrategyFor(collectionName string, req *http.Request) RoutingStrategy
+}
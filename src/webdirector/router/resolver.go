@@ -0,0 +1,95 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// collectionHeader lets a client behind a proxy that rewrites Host still
+// tell the director which collection it wants.
+const collectionHeader = "X-Nimbus-Collection"
+
+// CollectionResolver extracts a collection name from a request using one
+// resolution mechanism. ok is false (not an error) when this mechanism
+// simply doesn't apply to the request, so Route can fall through to the
+// next resolver in the chain.
+type CollectionResolver interface {
+	Resolve(req *http.Request, serviceDomain string) (collectionName string, ok bool)
+}
+
+// HostnameResolver extracts the collection from the
+// "<collection>.<service domain>" Host header — the original, and still
+// primary, resolution mechanism.
+type HostnameResolver struct{}
+
+func (HostnameResolver) Resolve(req *http.Request, serviceDomain string) (string, bool) {
+	hostName, ok := req.Header["HOST"]
+	if !ok {
+		return "", false
+	}
+	routingHostName := strings.Split(hostName[0], ":")[0]
+	if routingHostName == serviceDomain {
+		return "", false
+	}
+	collectionName := parseCollectionFromHostName(routingHostName, serviceDomain)
+	return collectionName, collectionName != ""
+}
+
+// PathPrefixResolver extracts the collection from a /<collection>/...
+// URL path prefix. This is the fallback for HTTP/1.0 clients and other
+// callers that can't set a Host header at all.
+type PathPrefixResolver struct{}
+
+func (PathPrefixResolver) Resolve(req *http.Request, serviceDomain string) (string, bool) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	if path == "" {
+		return "", false
+	}
+	return strings.SplitN(path, "/", 2)[0], true
+}
+
+// HeaderResolver extracts the collection from X-Nimbus-Collection, for
+// clients behind proxies that rewrite Host.
+type HeaderResolver struct{}
+
+func (HeaderResolver) Resolve(req *http.Request, serviceDomain string) (string, bool) {
+	collectionName := req.Header.Get(collectionHeader)
+	return collectionName, collectionName != ""
+}
+
+var resolversByName = map[string]CollectionResolver{
+	"hostname":    HostnameResolver{},
+	"path_prefix": PathPrefixResolver{},
+	"header":      HeaderResolver{},
+}
+
+// defaultResolverNames is the order resolvers run in when Config doesn't
+// specify one: the cheap, unambiguous hostname check first, then the
+// fallbacks for clients that can't set Host.
+var defaultResolverNames = []string{"hostname", "path_prefix", "header"}
+
+// resolverChain builds the ordered, enabled resolver list for a Config.
+// An empty/unset names list means "all of them, in the default order."
+func resolverChain(names []string) []CollectionResolver {
+	if len(names) == 0 {
+		names = defaultResolverNames
+	}
+	chain := make([]CollectionResolver, 0, len(names))
+	for _, name := range names {
+		if resolver, ok := resolversByName[name]; ok {
+			chain = append(chain, resolver)
+		}
+	}
+	return chain
+}
+
+// parseCollectionFromHostName extracts the <collection> label from a
+// "<collection>.<service domain>" hostname, or "" if routingHostName
+// isn't actually a subdomain of serviceDomain.
+func parseCollectionFromHostName(routingHostName, serviceDomain string) string {
+	suffix := "." + serviceDomain
+	if !strings.HasSuffix(routingHostName, suffix) {
+		return ""
+	}
+	return strings.TrimSuffix(routingHostName, suffix)
+}
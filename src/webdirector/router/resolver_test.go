@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostnameResolver(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/", nil)
+	req.Header["HOST"] = []string{"mycollection.example.com"}
+
+	name, ok := HostnameResolver{}.Resolve(req, "example.com")
+	if !ok || name != "mycollection" {
+		t.Fatalf("got (%q, %v), want (\"mycollection\", true)", name, ok)
+	}
+}
+
+func TestHostnameResolverBareServiceDomain(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/", nil)
+	req.Header["HOST"] = []string{"example.com"}
+
+	if _, ok := (HostnameResolver{}).Resolve(req, "example.com"); ok {
+		t.Fatalf("expected no match for a request to the bare service domain")
+	}
+}
+
+func TestPathPrefixResolver(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/mycollection/some/object", nil)
+
+	name, ok := PathPrefixResolver{}.Resolve(req, "example.com")
+	if !ok || name != "mycollection" {
+		t.Fatalf("got (%q, %v), want (\"mycollection\", true)", name, ok)
+	}
+}
+
+func TestHeaderResolver(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/", nil)
+	req.Header.Set(collectionHeader, "mycollection")
+
+	name, ok := HeaderResolver{}.Resolve(req, "example.com")
+	if !ok || name != "mycollection" {
+		t.Fatalf("got (%q, %v), want (\"mycollection\", true)", name, ok)
+	}
+}
+
+// TestResolverChainPrefersEarlierResolvers exercises the ordered fallback
+// chain: a request with no Host header but both a path prefix and the
+// collection header set should resolve via path_prefix, since it comes
+// before header in defaultResolverNames.
+func TestResolverChainPrefersEarlierResolvers(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/mycollection/object", nil)
+	req.Header.Set(collectionHeader, "shouldnotbeused")
+
+	var got string
+	for _, resolver := range resolverChain(nil) {
+		if name, ok := resolver.Resolve(req, "example.com"); ok {
+			got = name
+			break
+		}
+	}
+	if got != "mycollection" {
+		t.Fatalf("resolverChain resolved %q, want \"mycollection\" (path_prefix should win over header)", got)
+	}
+}
+
+// TestResolverChainAllFail covers the 400-only-when-every-resolver-fails
+// rule: a request with no Host header, no path, and no collection header
+// should fail every resolver in the chain.
+func TestResolverChainAllFail(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/", nil)
+
+	for _, resolver := range resolverChain(nil) {
+		if _, ok := resolver.Resolve(req, "example.com"); ok {
+			t.Fatalf("expected every default resolver to fail for a bare request")
+		}
+	}
+}
+
+func TestResolverChainRespectsConfiguredSubset(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://ignored/mycollection/object", nil)
+
+	chain := resolverChain([]string{"header"})
+	if len(chain) != 1 {
+		t.Fatalf("got %d resolvers, want exactly the configured \"header\" one", len(chain))
+	}
+	if _, ok := chain[0].Resolve(req, "example.com"); ok {
+		t.Fatalf("a path-prefix request should not resolve via a header-only chain")
+	}
+}
@@ -2,9 +2,14 @@ package router
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"webdirector/avail"
 	"webdirector/hosts"
@@ -12,100 +17,244 @@ import (
 )
 
 type routerErrorImpl struct {
-	httpCode     int
-	errorMessage string
+	httpCode      int
+	errorMessage  string
+	correlationID string
+	headers       http.Header
+}
+
+// newRouterError builds a routerErrorImpl carrying the request's
+// correlation ID, so it survives to the HTTP boundary and the access log.
+func newRouterError(correlationID string, httpCode int, format string, args ...interface{}) routerErrorImpl {
+	return routerErrorImpl{
+		httpCode:      httpCode,
+		errorMessage:  fmt.Sprintf(format, args...),
+		correlationID: correlationID,
+	}
+}
+
+// newRateLimitedError builds the 429 routerErrorImpl for a request a
+// Limiter rejected, with a Retry-After header telling the caller how long
+// to back off.
+func newRateLimitedError(correlationID string, retryAfter time.Duration) routerErrorImpl {
+	// Round up, with a floor of 1: a sub-second retryAfter still needs a
+	// Retry-After of at least 1, or the client reads "retry immediately"
+	// and the limit is never actually backed off from.
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	headers := make(http.Header)
+	headers.Set("Retry-After", strconv.Itoa(seconds))
+	return routerErrorImpl{
+		httpCode:      http.StatusTooManyRequests,
+		errorMessage:  "rate limit exceeded",
+		correlationID: correlationID,
+		headers:       headers,
+	}
 }
 
 type routerImpl struct {
 	managmentAPIDests  mgmtapi.ManagementAPIDestinations
 	hostsForCollection hosts.HostsForCollection
 	availability       avail.Availability
+	config             *ConfigStore
+	portPolicy         PortPolicy
+	strategyPolicy     StrategyPolicy
+	limiter            Limiter
 }
 
-var (
-	serviceDomain string
-	destPortMap   map[string]string
-)
-
-func init() {
-	serviceDomain = os.Getenv("NIMBUS_IO_SERVICE_DOMAIN")
-
-	readDestPort := os.Getenv("NIMBUSIO_WEB_PUBLIC_READER_PORT")
-	writeDestPort := os.Getenv("NIMBUSIO_WEB_WRITER_PORT")
-	destPortMap = map[string]string{
-		"POST":   writeDestPort,
-		"DELETE": writeDestPort,
-		"PUT":    writeDestPort,
-		"PATCH":  writeDestPort,
-		"HEAD":   readDestPort,
-		"GET":    readDestPort}
-}
-
-// NewRouter returns an entity that implements the Router interface
+// NewRouter returns an entity that implements the Router interface. The
+// service domain, backend pools, and collection overrides are read from
+// config's live Config on every Route call, so a config.Reload takes
+// effect for the next request without restarting the router; an
+// in-flight request keeps running under whatever Config it already read.
+//
+// portPolicy and strategyPolicy may be nil, in which case NewRouter falls
+// back to config's own pool definitions and health-weighted P2C host
+// selection, respectively. limiter may also be nil, in which case Route
+// applies no rate limiting.
 func NewRouter(managmentAPIDests mgmtapi.ManagementAPIDestinations,
 	hostsForCollection hosts.HostsForCollection,
-	availability avail.Availability) Router {
+	availability avail.Availability,
+	config *ConfigStore,
+	portPolicy PortPolicy,
+	strategyPolicy StrategyPolicy,
+	limiter Limiter) Router {
+
+	if portPolicy == nil {
+		portPolicy = NewConfigPortPolicy(config)
+	}
 
 	return &routerImpl{managmentAPIDests: managmentAPIDests,
-		hostsForCollection: hostsForCollection, availability: availability}
+		hostsForCollection: hostsForCollection, availability: availability,
+		config: config, portPolicy: portPolicy, strategyPolicy: strategyPolicy,
+		limiter: limiter}
 }
 
-// Route reads a request and decides where it should go <host:port>
-func (router *routerImpl) Route(req *http.Request) (string, error) {
+// Route reads a request and decides where it should go <host:port>. It
+// carries a correlation ID and an OpenTelemetry span through its
+// subordinate lookups, and emits one structured JSON access log line
+// before returning, whatever the outcome.
+//
+// report is the passive circuit breaker hook: it is non-nil whenever dest
+// names an actual backend, and the caller must call it exactly once, after
+// the proxied request completes, with whether that request failed. Route
+// itself never knows if the proxy succeeded - only the caller, after it
+// has actually made the request, does.
+func (router *routerImpl) Route(req *http.Request) (dest string, report func(failed bool), err error) {
+	start := time.Now()
+	correlationID := correlationIDFromRequest(req)
+	cfg := router.config.Current()
 
-	// TODO: be able to handle http requests from http 1.0 clients w/o a
-	// host header to at least the website, if nothing else.
-	hostName, ok := req.Header["HOST"]
-	if !ok {
-		return "", routerErrorImpl{httpCode: http.StatusBadRequest,
-			errorMessage: "HOST header not found"}
-	}
-	routingHostName := strings.Split(hostName[0], ":")[0]
-	if !strings.HasSuffix(routingHostName, serviceDomain) {
-		return "", routerErrorImpl{httpCode: http.StatusNotFound,
-			errorMessage: fmt.Sprintf("Invalid HOST '%s'", routingHostName)}
+	ctx, span := tracer.Start(req.Context(), "router.Route")
+	span.SetAttributes(attribute.String("correlation_id", correlationID))
+	defer span.End()
+
+	var collectionName, strategyName string
+	defer func() {
+		entry := accessLogEntry{
+			CorrelationID: correlationID,
+			Collection:    collectionName,
+			Host:          dest,
+			Strategy:      strategyName,
+			LatencyMS:     float64(time.Since(start)) / float64(time.Millisecond),
+			Method:        req.Method,
+			ClientIP:      clientIP(cfg, req),
+		}
+		if routerErr, ok := err.(routerErrorImpl); ok {
+			entry.Error = routerErr.errorMessage
+			entry.HTTPCode = routerErr.httpCode
+		}
+		logAccess(entry)
+	}()
+
+	if hostName, ok := req.Header["HOST"]; ok {
+		if strings.Split(hostName[0], ":")[0] == cfg.ServiceDomain {
+			// this is not a request specific to any particular
+			// collection - e.g. a request to the bare service domain.
+			dest = router.managmentAPIDests.Next()
+			return
+		}
 	}
 
-	if routingHostName == serviceDomain {
-		// this is not a request specific to any particular collection
-		// TODO: figure out how to route these requests.
-		// in production, this might not matter.
-		return router.managmentAPIDests.Next(), nil
+	for _, resolver := range resolverChain(cfg.Resolvers) {
+		if name, ok := resolver.Resolve(req, cfg.ServiceDomain); ok {
+			collectionName = name
+			break
+		}
+	}
+	if collectionName == "" {
+		if cfg.DefaultBackend != "" {
+			dest = cfg.DefaultBackend
+			return
+		}
+		err = newRouterError(correlationID, http.StatusBadRequest,
+			"could not resolve a collection for this request")
+		return
 	}
+	span.SetAttributes(attribute.String("collection", collectionName))
 
-	destPort, ok := destPortMap[req.Method]
-	if !ok {
-		return "", routerErrorImpl{httpCode: http.StatusBadRequest,
-			errorMessage: fmt.Sprintf("Unknown method '%s'", req.Method)}
+	if router.limiter != nil {
+		if allowed, retryAfter := router.limiter.Allow(ctx, collectionName, methodClass(req.Method)); !allowed {
+			err = newRateLimitedError(correlationID, retryAfter)
+			return
+		}
 	}
 
-	collectionName := parseCollectionFromHostName(routingHostName)
-	if collectionName == "" {
-		return "", routerErrorImpl{httpCode: http.StatusNotFound,
-			errorMessage: fmt.Sprintf("Unparseable host name '%s'", hostName)}
+	destPort, portErr := router.portPolicy.DestPort(collectionName, req)
+	if portErr != nil {
+		err = newRouterError(correlationID, http.StatusBadRequest, "%s", portErr)
+		return
 	}
 
-	hostsForCollection, err := router.hostsForCollection.GetHostNames(collectionName)
-	if err != nil {
-		return "", routerErrorImpl{httpCode: http.StatusNotFound,
-			errorMessage: fmt.Sprintf("no hosts for collection '%s'", collectionName)}
+	hostsCtx, hostsSpan := tracer.Start(ctx, "hosts.GetHostNames")
+	hostsForCollection, hostsErr := router.hostsForCollection.GetHostNames(hostsCtx, collectionName)
+	hostsSpan.End()
+	if hostsErr != nil {
+		err = newRouterError(correlationID, http.StatusNotFound, "no hosts for collection '%s'", collectionName)
+		return
 	}
 
-	availableHosts, err := router.availability.AvailableHosts(
-		hostsForCollection, destPort)
-	if err != nil {
-		return "", routerErrorImpl{httpCode: http.StatusInternalServerError,
-			errorMessage: fmt.Sprintf("collection '%s': %s", collectionName, err)}
+	availCtx, availSpan := tracer.Start(ctx, "avail.AvailableHosts")
+	availableHosts, availErr := router.availability.AvailableHosts(
+		availCtx, collectionName, hostsForCollection, destPort)
+	availSpan.End()
+	if availErr != nil {
+		err = newRouterError(correlationID, http.StatusInternalServerError,
+			"collection '%s': %s", collectionName, availErr)
+		return
 	}
 	if len(availableHosts) == 0 {
 		// XXX: the python web_director retries here, after a delay.
 		// IMO, that's what HTTP Status 503 is for
-		return "", routerErrorImpl{httpCode: http.StatusServiceUnavailable,
-			errorMessage: fmt.Sprintf("no hosts available for collection '%s'",
-				collectionName)}
+		err = newRouterError(correlationID, http.StatusServiceUnavailable,
+			"no hosts available for collection '%s'", collectionName)
+		return
+	}
+
+	_, pickSpan := tracer.Start(ctx, "router.pickHost")
+	defer pickSpan.End()
+
+	if router.strategyPolicy != nil {
+		if strategy := router.strategyPolicy.StrategyFor(collectionName, req); strategy != nil {
+			hostNames := make([]string, len(availableHosts))
+			for i, scored := range availableHosts {
+				hostNames[i] = scored.Host
+			}
+			chosen, pickErr := strategy.Pick(collectionName, hostNames, req)
+			if pickErr != nil {
+				err = newRouterError(correlationID, http.StatusInternalServerError,
+					"collection '%s': %s", collectionName, pickErr)
+				return
+			}
+			strategyName = strategy.Name()
+			dest = fmt.Sprintf("%s:%s", chosen, destPort)
+
+			var tracker ConnTracker
+			if t, ok := strategy.(ConnTracker); ok {
+				tracker = t
+				tracker.Acquire(chosen)
+			}
+			report = router.reportFunc(collectionName, chosen, destPort, tracker)
+			return
+		}
+	}
+
+	chosenHost := pickP2C(availableHosts)
+	strategyName = "p2c"
+	dest = fmt.Sprintf("%s:%s", chosenHost.Host, destPort)
+	report = router.reportFunc(collectionName, chosenHost.Host, destPort, nil)
+	return
+}
+
+// reportFunc builds the post-Route callback for a chosen (collection,
+// host, destPort): it feeds the outcome back into the passive circuit
+// breaker, and - for strategies that track in-flight connections, like
+// LeastConnections - releases the connection Acquire reserved for it.
+func (router *routerImpl) reportFunc(collectionName, host, destPort string, tracker ConnTracker) func(failed bool) {
+	return func(failed bool) {
+		router.availability.ReportResult(collectionName, host, destPort, failed)
+		if tracker != nil {
+			tracker.Release(host)
+		}
 	}
+}
 
-	return "", nil
+// pickP2C implements "power of two choices": draw two candidates at
+// random and route to whichever has the better health score. This is the
+// default host selection used when no RoutingStrategy is configured for a
+// collection; it spreads load across healthy hosts without the
+// coordination cost of tracking every backend's exact load.
+func pickP2C(candidates []avail.ScoredHost) avail.ScoredHost {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	i, j := rand.Intn(len(candidates)), rand.Intn(len(candidates))
+	if candidates[i].Score >= candidates[j].Score {
+		return candidates[i]
+	}
+	return candidates[j]
 }
 
 func (err routerErrorImpl) Error() string {
@@ -118,4 +267,12 @@ func (err routerErrorImpl) HTTPCode() int {
 
 func (err routerErrorImpl) ErrorMessage() string {
 	return err.errorMessage
-}
\ No newline at end of file
+}
+
+func (err routerErrorImpl) CorrelationID() string {
+	return err.correlationID
+}
+
+func (err routerErrorImpl) Headers() http.Header {
+	return err.headers
+}
@@ -0,0 +1,195 @@
+package router
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"webdirector/avail"
+)
+
+// RoutingStrategy picks one host out of a set of available candidates for
+// a given request. collectionName is the already-resolved collection (see
+// CollectionResolver) - not req.Host, which may be empty or unrelated to
+// the collection when the request reached the director via the
+// path-prefix or X-Nimbus-Collection fallbacks.
+type RoutingStrategy interface {
+	Pick(collectionName string, hosts []string, req *http.Request) (string, error)
+
+	// Name identifies the strategy for access logs and /status, e.g.
+	// "round_robin".
+	Name() string
+}
+
+// ConnTracker is implemented by strategies (LeastConnections) that need to
+// know when a request starts and finishes being served by a host. The
+// router calls Acquire before proxying and Release once the proxied
+// request completes.
+type ConnTracker interface {
+	Acquire(host string)
+	Release(host string)
+}
+
+func noCandidatesErr() error {
+	return fmt.Errorf("no candidate hosts to pick from")
+}
+
+// RoundRobin cycles through the candidate list in order.
+type RoundRobin struct {
+	next uint64
+}
+
+func (s *RoundRobin) Pick(collectionName string, hosts []string, req *http.Request) (string, error) {
+	if len(hosts) == 0 {
+		return "", noCandidatesErr()
+	}
+	i := atomic.AddUint64(&s.next, 1)
+	return hosts[int(i-1)%len(hosts)], nil
+}
+
+func (s *RoundRobin) Name() string { return "round_robin" }
+
+// Random picks a uniformly random candidate.
+type Random struct{}
+
+func (s Random) Pick(collectionName string, hosts []string, req *http.Request) (string, error) {
+	if len(hosts) == 0 {
+		return "", noCandidatesErr()
+	}
+	return hosts[rand.Intn(len(hosts))], nil
+}
+
+func (s Random) Name() string { return "random" }
+
+// ConsistentHash hashes the resolved collection name plus the object's key
+// path, so the same object consistently lands on the same backend and
+// downstream caches don't churn when the candidate set is otherwise
+// unchanged. It hashes collectionName rather than req.Host because req.Host
+// is empty (or unrelated to the collection) for requests resolved via the
+// path-prefix or X-Nimbus-Collection fallbacks.
+type ConsistentHash struct{}
+
+func (s ConsistentHash) Pick(collectionName string, hosts []string, req *http.Request) (string, error) {
+	if len(hosts) == 0 {
+		return "", noCandidatesErr()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(collectionName))
+	h.Write([]byte(req.URL.Path))
+	return hosts[int(h.Sum32())%len(hosts)], nil
+}
+
+func (s ConsistentHash) Name() string { return "consistent_hash" }
+
+// LeastConnections routes to whichever candidate currently has the fewest
+// in-flight requests, as tracked via Acquire/Release.
+type LeastConnections struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+// NewLeastConnections returns a ready-to-use LeastConnections strategy.
+func NewLeastConnections() *LeastConnections {
+	return &LeastConnections{inFlight: make(map[string]int)}
+}
+
+func (s *LeastConnections) Pick(collectionName string, hosts []string, req *http.Request) (string, error) {
+	if len(hosts) == 0 {
+		return "", noCandidatesErr()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best := hosts[0]
+	bestCount := s.inFlight[best]
+	for _, host := range hosts[1:] {
+		if c := s.inFlight[host]; c < bestCount {
+			best, bestCount = host, c
+		}
+	}
+	return best, nil
+}
+
+func (s *LeastConnections) Acquire(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[host]++
+}
+
+func (s *LeastConnections) Release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inFlight[host] > 0 {
+		s.inFlight[host]--
+	}
+}
+
+func (s *LeastConnections) Name() string { return "least_connections" }
+
+// LatencyWeighted picks among candidates via a weighted random choice over
+// the avail package's rolling health score - a blend of success rate and
+// probe latency (see avail.ScoredHost) - so traffic isn't pinned entirely
+// to a single "best" host, but does skew away from slow or flaky ones.
+type LatencyWeighted struct {
+	availability avail.Availability
+}
+
+// NewLatencyWeighted returns a LatencyWeighted strategy backed by the
+// given Availability's rolling health scores.
+func NewLatencyWeighted(availability avail.Availability) *LatencyWeighted {
+	return &LatencyWeighted{availability: availability}
+}
+
+// ResolveStrategy looks up a RoutingStrategy by the name used in a
+// Config's CollectionOverrides (e.g. "round_robin", "consistent_hash").
+// An empty name resolves to RoundRobin.
+func ResolveStrategy(name string, availability avail.Availability) (RoutingStrategy, error) {
+	switch name {
+	case "", "round_robin":
+		return &RoundRobin{}, nil
+	case "random":
+		return Random{}, nil
+	case "consistent_hash":
+		return ConsistentHash{}, nil
+	case "least_connections":
+		return NewLeastConnections(), nil
+	case "latency_weighted":
+		return NewLatencyWeighted(availability), nil
+	default:
+		return nil, fmt.Errorf("unknown routing strategy '%s'", name)
+	}
+}
+
+func (s *LatencyWeighted) Pick(collectionName string, hosts []string, req *http.Request) (string, error) {
+	if len(hosts) == 0 {
+		return "", noCandidatesErr()
+	}
+	scores := make(map[string]float64, len(hosts))
+	for _, status := range s.availability.Status() {
+		scores[status.Host] = status.Score
+	}
+
+	total := 0.0
+	weights := make([]float64, len(hosts))
+	for i, host := range hosts {
+		w := scores[host]
+		if w <= 0 {
+			w = 0.01 // every candidate keeps a small chance, even unscored ones
+		}
+		weights[i] = w
+		total += w
+	}
+
+	pick := rand.Float64() * total
+	for i, w := range weights {
+		pick -= w
+		if pick <= 0 {
+			return hosts[i], nil
+		}
+	}
+	return hosts[len(hosts)-1], nil
+}
+
+func (s *LatencyWeighted) Name() string { return "latency_weighted" }